@@ -0,0 +1,54 @@
+/*
+Copyright 2020 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounts
+
+// eventBufferSize bounds how many unconsumed RegistryEvents are buffered
+// before new ones are dropped. Controllers are expected to drain the
+// channel promptly; dropping under sustained back-pressure is preferable to
+// blocking the registry lock.
+const eventBufferSize = 64
+
+// RegistryEvent describes a change to a client held by the registry.
+type RegistryEvent struct {
+	// UID is the Issuer UID of the client the event relates to.
+	UID string
+
+	// Reason identifies why the client was rebuilt, e.g. "server_changed",
+	// "key_changed", "tls_verify_changed" or "eab_changed".
+	Reason string
+}
+
+// Events returns a channel on which the registry publishes a RegistryEvent
+// every time a client is rebuilt. This allows controllers to react to
+// rebuilds (e.g. invalidate cached orders/authorizations for that issuer)
+// instead of polling ListClients. The channel is not closed by the
+// registry; callers should stop reading once the registry itself is
+// discarded.
+func (r *registry) Events() <-chan RegistryEvent {
+	return r.events
+}
+
+// publish sends a RegistryEvent for each reason a client was rebuilt,
+// without blocking the caller if there is no room in the buffer.
+func (r *registry) publish(uid string, reasons []string) {
+	for _, reason := range reasons {
+		select {
+		case r.events <- RegistryEvent{UID: uid, Reason: reason}:
+		default:
+		}
+	}
+}
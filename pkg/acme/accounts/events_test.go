@@ -0,0 +1,51 @@
+/*
+Copyright 2020 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounts
+
+import "testing"
+
+func TestPublishDeliversOneEventPerReason(t *testing.T) {
+	r := &registry{events: make(chan RegistryEvent, eventBufferSize)}
+
+	r.publish("issuer-1", []string{reasonServerChanged, reasonKeyChanged})
+
+	for _, want := range []string{reasonServerChanged, reasonKeyChanged} {
+		select {
+		case ev := <-r.Events():
+			if ev.UID != "issuer-1" || ev.Reason != want {
+				t.Errorf("Events() = %+v, want UID=issuer-1 Reason=%s", ev, want)
+			}
+		default:
+			t.Fatalf("Events() had no event buffered for reason %s", want)
+		}
+	}
+}
+
+func TestPublishDropsRatherThanBlocksWhenBufferFull(t *testing.T) {
+	r := &registry{events: make(chan RegistryEvent, 1)}
+
+	r.publish("issuer-1", []string{reasonServerChanged, reasonKeyChanged})
+
+	if ev := <-r.Events(); ev.Reason != reasonServerChanged {
+		t.Fatalf("Events() first event = %+v, want Reason=%s", ev, reasonServerChanged)
+	}
+	select {
+	case ev := <-r.Events():
+		t.Fatalf("Events() had an unexpected second event buffered: %+v", ev)
+	default:
+	}
+}
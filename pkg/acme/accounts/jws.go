@@ -0,0 +1,78 @@
+/*
+Copyright 2020 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounts
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+)
+
+// jwk is the subset of RFC 7517 JSON Web Key fields needed to describe an
+// RSA public key in an ACME request, in the member order the ACME server
+// expects for a flattened JWS.
+type jwk struct {
+	E   string `json:"e"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+}
+
+// rsaJWK returns the JWK representation of an RSA public key.
+func rsaJWK(pub *rsa.PublicKey) jwk {
+	return jwk{
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+// flattenedJWS is a JWS using the JSON Flattened Serialization (RFC 7515
+// section 7.2.2), which is the form ACME servers require.
+type flattenedJWS struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// signJWS signs payload with key using RS256, producing a flattened JWS
+// whose protected header is protected (already fully populated by the
+// caller, including "alg").
+func signJWS(key *rsa.PrivateKey, protected interface{}, payload []byte) (*flattenedJWS, error) {
+	protectedJSON, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+	protectedB64 := base64.RawURLEncoding.EncodeToString(protectedJSON)
+	payloadB64 := base64.RawURLEncoding.EncodeToString(payload)
+
+	signingInput := protectedB64 + "." + payloadB64
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &flattenedJWS{
+		Protected: protectedB64,
+		Payload:   payloadB64,
+		Signature: base64.RawURLEncoding.EncodeToString(sig),
+	}, nil
+}
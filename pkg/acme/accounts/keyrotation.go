@@ -0,0 +1,260 @@
+/*
+Copyright 2020 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounts
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	acmeapi "golang.org/x/crypto/acme"
+)
+
+// Errors surfaced by RotateAccountKey so the issuer controller can decide
+// whether to retry the rotation or mark the Issuer degraded.
+var (
+	// ErrAccountNotFound is returned when the client registered for the given
+	// issuer UID has no ACME account cached, so there is no key to rotate, or
+	// when the ACME server answers the key-change request with 404 or 410.
+	// If no client is registered for the UID at all, ErrNotFound is returned.
+	ErrAccountNotFound = errors.New("acme: account not found")
+
+	// ErrUnauthorized is returned when the ACME server rejects the
+	// key-change request as not authorized for the current account.
+	ErrUnauthorized = errors.New("acme: key rotation unauthorized")
+
+	// ErrMalformedKeyChange is returned when the ACME server rejects the
+	// key-change request as malformed.
+	ErrMalformedKeyChange = errors.New("acme: malformed key-change request")
+)
+
+// KeyPersister is supplied by callers of RotateAccountKey. It is invoked
+// with the new private key after the ACME server has accepted the
+// key-change, but before the registry commits the swap, so that the caller
+// can persist the new key back to its referenced Kubernetes Secret first.
+// If it returns an error, the rotation is aborted and the previously
+// registered client/key is left untouched.
+type KeyPersister func(newKey *rsa.PrivateKey) error
+
+// RotateAccountKey performs the RFC 8555 account key-change flow (section
+// 7.3.5) for the client registered under uid, replacing its account's
+// private key with newKey. ctx bounds the key-change round-trip made to the
+// ACME server.
+//
+// The current client signs an inner JWS over the payload
+// {"account": <kid>, "oldKey": <jwk of the old key>} using newKey, then
+// wraps that inner JWS as the payload of an outer JWS signed with the
+// current (old) key and POSTs it to the directory's keyChange URL. On
+// success, persist is called with the new key, and only if it succeeds is
+// the stored client atomically swapped for one built from newKey; the
+// cached KID is preserved since the account URL does not change.
+//
+// The key-change round-trip runs without r.lock held, the same as
+// ensureClient, so a slow or hung ACME server only stalls this issuer's
+// rotation, not reads/writes for every other issuer; the lock is only taken
+// to install the result.
+func (r *registry) RotateAccountKey(ctx context.Context, uid string, newKey *rsa.PrivateKey, persist KeyPersister) error {
+	r.lock.RLock()
+	existing, ok := r.clients[uid]
+	r.lock.RUnlock()
+	if !ok {
+		return ErrNotFound
+	}
+	if existing.account == nil {
+		return ErrAccountNotFound
+	}
+	cl, ok := existing.Interface.(*acmeapi.Client)
+	if !ok {
+		return fmt.Errorf("acme: client for issuer %q does not support key rotation", uid)
+	}
+	oldKey, ok := cl.Key.(*rsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("acme: client for issuer %q is not using an RSA account key", uid)
+	}
+
+	if err := keyChange(ctx, cl, oldKey, newKey, existing.account.URI); err != nil {
+		return err
+	}
+
+	if persist != nil {
+		if err := persist(newKey); err != nil {
+			return fmt.Errorf("acme: failed to persist rotated account key: %w", err)
+		}
+	}
+
+	// Build the replacement client explicitly rather than shallow-copying
+	// *cl: acmeapi.Client carries unexported mutex-guarded directory/nonce
+	// state, and copying the struct would hand the old and new clients
+	// independent, freshly-zeroed mutexes guarding what is still shared
+	// underlying state - a copylocks violation and a real race against
+	// anything still holding the pre-rotation client (e.g. via GetClient).
+	rotated := &acmeapi.Client{
+		Key:          newKey,
+		HTTPClient:   cl.HTTPClient,
+		DirectoryURL: cl.DirectoryURL,
+		UserAgent:    cl.UserAgent,
+		KID:          cl.KID,
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	// re-read under the write lock: the client may have been rebuilt or
+	// removed while we were talking to the ACME server above.
+	current, ok := r.clients[uid]
+	if !ok || current.account == nil || current.account.URI != existing.account.URI {
+		return fmt.Errorf("acme: client for issuer %q changed during key rotation, aborting", uid)
+	}
+
+	newOpts := current.stableOptions
+	publicNBytes, _ := newKey.PublicKey.N.GobEncode()
+	newOpts.publicKey = string(publicNBytes)
+	newOpts.exponent = newKey.PublicKey.E
+
+	r.clients[uid] = clientWithMeta{
+		Interface:     rotated,
+		stableOptions: newOpts,
+		account:       current.account,
+		solvers:       current.solvers,
+	}
+	return nil
+}
+
+// keyChange drives the RFC 8555 key-change protocol against the directory's
+// keyChange endpoint, authenticating the outer request with oldKey and the
+// account's current KID.
+func keyChange(ctx context.Context, cl *acmeapi.Client, oldKey, newKey *rsa.PrivateKey, accountURL string) error {
+	dir, err := cl.Discover(ctx)
+	if err != nil {
+		return err
+	}
+	if dir.KeyChangeURL == "" {
+		return fmt.Errorf("acme: server does not advertise a key-change endpoint")
+	}
+
+	innerPayload, err := marshalKeyChangePayload(accountURL, oldKey)
+	if err != nil {
+		return err
+	}
+	inner, err := signJWS(newKey, map[string]interface{}{
+		"alg": "RS256",
+		"jwk": rsaJWK(&newKey.PublicKey),
+		"url": dir.KeyChangeURL,
+	}, innerPayload)
+	if err != nil {
+		return err
+	}
+	innerJSON, err := json.Marshal(inner)
+	if err != nil {
+		return err
+	}
+
+	// The anti-replay nonce must come from the directory's dedicated
+	// newNonce resource (RFC 8555 section 7.2): keyChange is a POST-only
+	// resource and isn't guaranteed to answer a HEAD request with a
+	// Replay-Nonce header on every ACME server.
+	if dir.NonceURL == "" {
+		return fmt.Errorf("acme: server does not advertise a newNonce endpoint")
+	}
+	nonce, err := fetchNonce(ctx, cl, dir.NonceURL)
+	if err != nil {
+		return err
+	}
+	outer, err := signJWS(oldKey, map[string]interface{}{
+		"alg":   "RS256",
+		"kid":   accountURL,
+		"nonce": nonce,
+		"url":   dir.KeyChangeURL,
+	}, innerJSON)
+	if err != nil {
+		return err
+	}
+	outerJSON, err := json.Marshal(outer)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dir.KeyChangeURL, bytes.NewReader(outerJSON))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/jose+json")
+	req.Header.Set("User-Agent", cl.UserAgent)
+
+	resp, err := cl.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return classifyKeyChangeResponse(resp)
+}
+
+// classifyKeyChangeResponse maps an ACME key-change response to one of the
+// sentinel errors the issuer controller distinguishes between, or nil on
+// success.
+func classifyKeyChangeResponse(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return ErrMalformedKeyChange
+	case http.StatusNotFound, http.StatusGone:
+		return ErrAccountNotFound
+	default:
+		return fmt.Errorf("acme: key-change request failed with status %s", resp.Status)
+	}
+}
+
+// marshalKeyChangePayload builds the inner key-change payload described by
+// RFC 8555 section 7.3.5: the account URL being rotated and the JWK of its
+// current ("old") key, so the server can confirm the caller owns both keys.
+func marshalKeyChangePayload(accountURL string, oldKey *rsa.PrivateKey) ([]byte, error) {
+	return json.Marshal(struct {
+		Account string `json:"account"`
+		OldKey  jwk    `json:"oldKey"`
+	}{
+		Account: accountURL,
+		OldKey:  rsaJWK(&oldKey.PublicKey),
+	})
+}
+
+// fetchNonce retrieves a fresh anti-replay nonce, as required before every
+// ACME POST, by sending a HEAD request to url (the directory's newNonce
+// resource) and reading its Replay-Nonce header.
+func fetchNonce(ctx context.Context, cl *acmeapi.Client, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := cl.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", fmt.Errorf("acme: server did not return a Replay-Nonce for %s", url)
+	}
+	return nonce, nil
+}
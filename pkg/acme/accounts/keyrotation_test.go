@@ -0,0 +1,175 @@
+/*
+Copyright 2020 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounts
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	acmeapi "golang.org/x/crypto/acme"
+
+	cmacme "github.com/jetstack/cert-manager/pkg/apis/acme/v1alpha2"
+)
+
+// fakeACMEServer is a minimal RFC 8555 server, just capable enough to drive
+// account registration and the key-change flow under test.
+type fakeACMEServer struct {
+	t   *testing.T
+	srv *httptest.Server
+
+	keyChangeBodies []flattenedJWS
+}
+
+func newFakeACMEServer(t *testing.T) *fakeACMEServer {
+	f := &fakeACMEServer{t: t}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/directory", f.handleDirectory)
+	mux.HandleFunc("/new-nonce", f.handleNewNonce)
+	mux.HandleFunc("/new-account", f.handleNewAccount)
+	mux.HandleFunc("/key-change", f.handleKeyChange)
+	f.srv = httptest.NewServer(mux)
+	return f
+}
+
+func (f *fakeACMEServer) Close() { f.srv.Close() }
+
+func (f *fakeACMEServer) setNonce(w http.ResponseWriter) {
+	w.Header().Set("Replay-Nonce", "test-nonce")
+}
+
+func (f *fakeACMEServer) handleDirectory(w http.ResponseWriter, r *http.Request) {
+	f.setNonce(w)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"newNonce":   f.srv.URL + "/new-nonce",
+		"newAccount": f.srv.URL + "/new-account",
+		"newOrder":   f.srv.URL + "/new-order",
+		"keyChange":  f.srv.URL + "/key-change",
+	})
+}
+
+func (f *fakeACMEServer) handleNewNonce(w http.ResponseWriter, r *http.Request) {
+	f.setNonce(w)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *fakeACMEServer) handleNewAccount(w http.ResponseWriter, r *http.Request) {
+	f.setNonce(w)
+	w.Header().Set("Location", f.srv.URL+"/acct/1")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "valid"})
+}
+
+func (f *fakeACMEServer) handleKeyChange(w http.ResponseWriter, r *http.Request) {
+	var outer flattenedJWS
+	if err := json.NewDecoder(r.Body).Decode(&outer); err != nil {
+		f.t.Fatalf("key-change request body was not a flattened JWS: %v", err)
+	}
+	f.keyChangeBodies = append(f.keyChangeBodies, outer)
+
+	f.setNonce(w)
+	w.WriteHeader(http.StatusOK)
+}
+
+func mustGenerateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	return key
+}
+
+func TestRotateAccountKey(t *testing.T) {
+	srv := newFakeACMEServer(t)
+	defer srv.Close()
+
+	oldKey := mustGenerateKey(t)
+	newKey := mustGenerateKey(t)
+
+	ctx := context.Background()
+	r := NewDefaultRegistry().(*registry)
+	config := cmacme.ACMEIssuer{Server: srv.srv.URL + "/directory"}
+
+	if err := r.AddClient(ctx, "issuer-1", config, oldKey, nil); err != nil {
+		t.Fatalf("AddClient() error = %v", err)
+	}
+
+	var persisted *rsa.PrivateKey
+	persist := func(k *rsa.PrivateKey) error {
+		persisted = k
+		return nil
+	}
+
+	if err := r.RotateAccountKey(ctx, "issuer-1", newKey, persist); err != nil {
+		t.Fatalf("RotateAccountKey() error = %v", err)
+	}
+
+	if persisted != newKey {
+		t.Error("RotateAccountKey() did not invoke the KeyPersister with the new key")
+	}
+	if len(srv.keyChangeBodies) != 1 {
+		t.Fatalf("expected exactly one key-change request, got %d", len(srv.keyChangeBodies))
+	}
+	outer := srv.keyChangeBodies[0]
+	if outer.Protected == "" || outer.Payload == "" || outer.Signature == "" {
+		t.Errorf("outer key-change JWS is missing fields: %+v", outer)
+	}
+
+	cl, err := r.GetClient("issuer-1")
+	if err != nil {
+		t.Fatalf("GetClient() error = %v", err)
+	}
+	acmeClient, ok := cl.(*acmeapi.Client)
+	if !ok {
+		t.Fatalf("GetClient() returned %T, want *acme.Client", cl)
+	}
+	if acmeClient.Key != crypto.Signer(newKey) {
+		t.Error("registry client was not swapped to the rotated key")
+	}
+}
+
+func TestClassifyKeyChangeResponse(t *testing.T) {
+	tests := map[int]error{
+		http.StatusOK:                  nil,
+		http.StatusUnauthorized:        ErrUnauthorized,
+		http.StatusForbidden:           ErrUnauthorized,
+		http.StatusBadRequest:          ErrMalformedKeyChange,
+		http.StatusUnprocessableEntity: ErrMalformedKeyChange,
+		http.StatusNotFound:            ErrAccountNotFound,
+		http.StatusGone:                ErrAccountNotFound,
+	}
+
+	for status, want := range tests {
+		resp := &http.Response{StatusCode: status, Status: http.StatusText(status)}
+		got := classifyKeyChangeResponse(resp)
+		if got != want {
+			t.Errorf("classifyKeyChangeResponse(%d) = %v, want %v", status, got, want)
+		}
+	}
+
+	resp := &http.Response{StatusCode: http.StatusInternalServerError, Status: "500 Internal Server Error"}
+	if err := classifyKeyChangeResponse(resp); err == nil {
+		t.Error("classifyKeyChangeResponse(500) = nil, want a non-nil error")
+	}
+}
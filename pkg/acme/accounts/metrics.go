@@ -0,0 +1,84 @@
+/*
+Copyright 2020 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounts
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Rebuild reasons recorded against acme_registry_client_rebuilds_total,
+// derived by diffing the old and new stableOptions for an issuer.
+const (
+	reasonServerChanged    = "server_changed"
+	reasonKeyChanged       = "key_changed"
+	reasonTLSVerifyChanged = "tls_verify_changed"
+	reasonEABChanged       = "eab_changed"
+	reasonSolversChanged   = "solvers_changed"
+	reasonTransportChanged = "transport_changed"
+)
+
+var (
+	registryClients = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "acme_registry_clients",
+		Help: "The number of ACME clients currently held by the registry.",
+	})
+
+	registryClientRebuilds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "acme_registry_client_rebuilds_total",
+		Help: "The number of times an ACME client has been rebuilt, by reason.",
+	}, []string{"reason"})
+
+	registryLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "acme_registry_lookup_total",
+		Help: "The number of GetClient lookups performed against the registry, by result.",
+	}, []string{"result"})
+
+	registryEnsures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "acme_registry_ensure_total",
+		Help: "The number of AddClient/ensureClient calls handled by the registry, by result.",
+	}, []string{"result"})
+)
+
+func init() {
+	prometheus.MustRegister(registryClients, registryClientRebuilds, registryLookups, registryEnsures)
+}
+
+// diffRebuildReasons compares the old and new stableOptions for an issuer
+// and returns the set of reasons, if any, that a client rebuild is needed.
+// An empty slice means the two are equivalent for rebuild purposes.
+func diffRebuildReasons(old, updated stableOptions) []string {
+	var reasons []string
+	if old.serverURL != updated.serverURL {
+		reasons = append(reasons, reasonServerChanged)
+	}
+	if old.publicKey != updated.publicKey || old.exponent != updated.exponent {
+		reasons = append(reasons, reasonKeyChanged)
+	}
+	if old.skipVerifyTLS != updated.skipVerifyTLS {
+		reasons = append(reasons, reasonTLSVerifyChanged)
+	}
+	if old.eabKeyID != updated.eabKeyID || old.eabKey != updated.eabKey {
+		reasons = append(reasons, reasonEABChanged)
+	}
+	if old.solversHash != updated.solversHash {
+		reasons = append(reasons, reasonSolversChanged)
+	}
+	if old.proxyURL != updated.proxyURL || old.rootCAsHash != updated.rootCAsHash {
+		reasons = append(reasons, reasonTransportChanged)
+	}
+	return reasons
+}
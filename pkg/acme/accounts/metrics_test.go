@@ -0,0 +1,125 @@
+/*
+Copyright 2020 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounts
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDiffRebuildReasons(t *testing.T) {
+	base := stableOptions{
+		serverURL:     "https://acme.example.com/directory",
+		skipVerifyTLS: false,
+		issuerUID:     "issuer-1",
+		publicKey:     "pub-a",
+		exponent:      65537,
+		eabKeyID:      "eab-kid",
+		eabKey:        "eab-key",
+		solversHash:   "solvers-a",
+		proxyURL:      "",
+		rootCAsHash:   "cabundle-a",
+	}
+
+	tests := map[string]struct {
+		mutate func(o stableOptions) stableOptions
+		want   []string
+	}{
+		"no changes": {
+			mutate: func(o stableOptions) stableOptions { return o },
+			want:   nil,
+		},
+		"server changed": {
+			mutate: func(o stableOptions) stableOptions {
+				o.serverURL = "https://other.example.com/directory"
+				return o
+			},
+			want: []string{reasonServerChanged},
+		},
+		"public key changed": {
+			mutate: func(o stableOptions) stableOptions {
+				o.publicKey = "pub-b"
+				return o
+			},
+			want: []string{reasonKeyChanged},
+		},
+		"exponent changed": {
+			mutate: func(o stableOptions) stableOptions {
+				o.exponent = 3
+				return o
+			},
+			want: []string{reasonKeyChanged},
+		},
+		"tls verify changed": {
+			mutate: func(o stableOptions) stableOptions {
+				o.skipVerifyTLS = true
+				return o
+			},
+			want: []string{reasonTLSVerifyChanged},
+		},
+		"eab key id changed": {
+			mutate: func(o stableOptions) stableOptions {
+				o.eabKeyID = "other-kid"
+				return o
+			},
+			want: []string{reasonEABChanged},
+		},
+		"solvers changed": {
+			mutate: func(o stableOptions) stableOptions {
+				o.solversHash = "solvers-b"
+				return o
+			},
+			want: []string{reasonSolversChanged},
+		},
+		"proxy url changed": {
+			mutate: func(o stableOptions) stableOptions {
+				o.proxyURL = "http://proxy.example.com:8080"
+				return o
+			},
+			want: []string{reasonTransportChanged},
+		},
+		"ca bundle changed": {
+			mutate: func(o stableOptions) stableOptions {
+				o.rootCAsHash = "cabundle-b"
+				return o
+			},
+			want: []string{reasonTransportChanged},
+		},
+		"multiple fields changed": {
+			mutate: func(o stableOptions) stableOptions {
+				o.serverURL = "https://other.example.com/directory"
+				o.skipVerifyTLS = true
+				return o
+			},
+			want: []string{reasonServerChanged, reasonTLSVerifyChanged},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			updated := test.mutate(base)
+			got := diffRebuildReasons(base, updated)
+			sort.Strings(got)
+			want := append([]string(nil), test.want...)
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("diffRebuildReasons() = %v, want %v", got, want)
+			}
+		})
+	}
+}
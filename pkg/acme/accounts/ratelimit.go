@@ -0,0 +1,98 @@
+/*
+Copyright 2020 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounts
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimitedTransport wraps a RoundTripper, refusing to send further
+// requests to a host that has recently responded with a 429 or 503 and a
+// Retry-After header, until the advertised deadline has elapsed.
+//
+// ACME servers such as Let's Encrypt enforce per-account and per-endpoint
+// rate limits; retrying against them as fast as the controller loop allows
+// just digs the hole deeper; honouring Retry-After keeps us a good citizen
+// and lets the backlog drain once the window resets.
+type rateLimitedTransport struct {
+	next http.RoundTripper
+
+	mu         sync.Mutex
+	blockedTil map[string]time.Time
+	nowFn      func() time.Time
+}
+
+// newRateLimitedTransport wraps next with Retry-After aware rate limiting.
+func newRateLimitedTransport(next http.RoundTripper) *rateLimitedTransport {
+	return &rateLimitedTransport{
+		next:       next,
+		blockedTil: make(map[string]time.Time),
+		nowFn:      time.Now,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+
+	t.mu.Lock()
+	until, blocked := t.blockedTil[host]
+	t.mu.Unlock()
+	if blocked {
+		if now := t.nowFn(); now.Before(until) {
+			return nil, fmt.Errorf("acme: rate limited by %s until %s", host, until.Format(time.RFC3339))
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return resp, nil
+	}
+
+	retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), t.nowFn())
+	if !ok {
+		return resp, nil
+	}
+
+	t.mu.Lock()
+	t.blockedTil[host] = retryAfter
+	t.mu.Unlock()
+	return resp, nil
+}
+
+// parseRetryAfter parses a Retry-After header value, which may either be a
+// number of seconds or an HTTP-date, per RFC 7231 section 7.1.3.
+func parseRetryAfter(value string, now time.Time) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return now.Add(time.Duration(seconds) * time.Second), true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		return when, true
+	}
+	return time.Time{}, false
+}
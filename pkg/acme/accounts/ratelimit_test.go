@@ -0,0 +1,138 @@
+/*
+Copyright 2020 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounts
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		value  string
+		wantOK bool
+		wantAt time.Time
+	}{
+		"empty header": {
+			value:  "",
+			wantOK: false,
+		},
+		"delay in seconds": {
+			value:  "120",
+			wantOK: true,
+			wantAt: now.Add(120 * time.Second),
+		},
+		"http-date": {
+			value:  now.Add(time.Hour).Format(http.TimeFormat),
+			wantOK: true,
+			wantAt: now.Add(time.Hour),
+		},
+		"garbage value": {
+			value:  "not-a-valid-value",
+			wantOK: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := parseRetryAfter(test.value, now)
+			if ok != test.wantOK {
+				t.Fatalf("parseRetryAfter(%q) ok = %v, want %v", test.value, ok, test.wantOK)
+			}
+			if ok && !got.Equal(test.wantAt) {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", test.value, got, test.wantAt)
+			}
+		})
+	}
+}
+
+// fakeRoundTripper returns its canned responses in order, repeating the last
+// one, without making any real network call. calls counts every request
+// that reached it.
+type fakeRoundTripper struct {
+	responses []*http.Response
+	calls     int
+}
+
+func (f *fakeRoundTripper) RoundTrip(*http.Request) (*http.Response, error) {
+	i := f.calls
+	if i > len(f.responses)-1 {
+		i = len(f.responses) - 1
+	}
+	f.calls++
+	return f.responses[i], nil
+}
+
+func newResponse(status int, retryAfter string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: make(http.Header)}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+	return resp
+}
+
+func TestRateLimitedTransportBlocksUntilRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	next := &fakeRoundTripper{responses: []*http.Response{
+		newResponse(http.StatusTooManyRequests, "60"),
+		newResponse(http.StatusOK, ""),
+	}}
+	rt := newRateLimitedTransport(next)
+	rt.nowFn = func() time.Time { return now }
+
+	req := &http.Request{URL: &url.URL{Host: "acme.example.com"}}
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("first RoundTrip() error = %v", err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("first RoundTrip() status = %d, want 429", resp.StatusCode)
+	}
+
+	// Still within the back-off window: the request must not reach next.
+	if _, err := rt.RoundTrip(req); err == nil {
+		t.Error("RoundTrip() during the back-off window did not return an error")
+	}
+	if next.calls != 1 {
+		t.Errorf("RoundTrip() during the back-off window reached the underlying transport")
+	}
+
+	// Past the deadline: the request should go through and hit the 200.
+	rt.nowFn = func() time.Time { return now.Add(61 * time.Second) }
+	resp, err = rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() after the back-off window error = %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("RoundTrip() after the back-off window status = %d, want 200", resp.StatusCode)
+	}
+
+	// A different host must never be affected by another host's back-off.
+	other := &http.Request{URL: &url.URL{Host: "other.example.com"}}
+	next2 := &fakeRoundTripper{responses: []*http.Response{newResponse(http.StatusOK, "")}}
+	rt2 := newRateLimitedTransport(next2)
+	rt2.blockedTil["acme.example.com"] = now.Add(time.Hour)
+	rt2.nowFn = func() time.Time { return now }
+	if _, err := rt2.RoundTrip(other); err != nil {
+		t.Errorf("RoundTrip() for an unblocked host returned error = %v", err)
+	}
+}
@@ -17,10 +17,12 @@ limitations under the License.
 package accounts
 
 import (
+	"context"
 	"crypto/rsa"
-	"crypto/tls"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
-	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -35,18 +37,33 @@ import (
 // ErrNotFound is returned by GetClient if there is no ACME client registered.
 var ErrNotFound = errors.New("ACME client for issuer not initialised/available")
 
+// ErrSolverNotFound is returned by GetSolver if the client is registered but
+// has no solver configured for the requested challenge type.
+var ErrSolverNotFound = errors.New("no solver configured for challenge type")
+
 // A registry provides a means to store and access ACME clients using an issuer
 // objects UID.
 // This is used as a shared cache of ACME clients across various controllers.
 type Registry interface {
 	// AddClient will ensure the registry has a stored ACME client for the Issuer
 	// object with the given UID, configuration and private key.
-	AddClient(uid string, config cmacme.ACMEIssuer, privateKey *rsa.PrivateKey)
+	// If the ACME server requires an account to be registered (or the existing
+	// registration needs to be looked up for the given key), this will be
+	// performed as part of this call, and the resulting account will be cached
+	// alongside the client.
+	AddClient(ctx context.Context, uid string, config cmacme.ACMEIssuer, privateKey *rsa.PrivateKey, eabAccountKey []byte) error
 
 	// RemoveClient will remove a registered client using the UID of the Issuer
 	// resource that constructed it.
 	RemoveClient(uid string)
 
+	// RotateAccountKey performs the RFC 8555 account key-change flow for the
+	// client registered under uid, replacing its ACME account's private key
+	// with newKey. persist is called with the new key after the ACME server
+	// has accepted the change but before it is committed to the registry, so
+	// the caller can persist it back to the referenced Secret first.
+	RotateAccountKey(ctx context.Context, uid string, newKey *rsa.PrivateKey, persist KeyPersister) error
+
 	Getter
 }
 
@@ -57,17 +74,38 @@ type Getter interface {
 	// If no client is found, ErrNotFound will be returned.
 	GetClient(uid string) (acmecl.Interface, error)
 
+	// GetAccount will return the ACME account that was registered (or looked
+	// up) for the client with the given UID, as observed the last time the
+	// client was built. This allows callers to render account status
+	// (contacts, ToS agreement, orders URL, etc) without making an additional
+	// round-trip to the ACME server on every reconcile.
+	// If no client is found, ErrNotFound will be returned.
+	GetAccount(uid string) (*acmeapi.Account, error)
+
+	// GetSolver returns the instantiated challenge Solver for the client
+	// with the given UID that handles the given ACME challenge type.
+	// If no client is found, ErrNotFound will be returned. If the client
+	// has no solver configured for that challenge type, ErrSolverNotFound
+	// will be returned.
+	GetSolver(uid, challengeType string) (Solver, error)
+
 	// ListClients will return a full list of all ACME clients by their UIDs.
 	// This can be used to enumerate all registered clients and call RemoveClient
 	// on any clients that should no longer be registered, e.g. because their
 	// corresponding Issuer resource has been deleted.
 	ListClients() map[string]acmecl.Interface
+
+	// Events returns a channel on which a RegistryEvent is published every
+	// time a client is rebuilt, so callers can react (e.g. invalidate
+	// cached orders/authorizations) instead of polling ListClients.
+	Events() <-chan RegistryEvent
 }
 
 // NewDefaultRegistry returns a new default instantiation of a client registry.
 func NewDefaultRegistry() Registry {
 	return &registry{
 		clients: make(map[string]clientWithMeta),
+		events:  make(chan RegistryEvent, eventBufferSize),
 	}
 }
 
@@ -77,6 +115,9 @@ type registry struct {
 
 	// a map of an issuer's 'uid' to an ACME client with metadata
 	clients map[string]clientWithMeta
+
+	// events is published to whenever a client is rebuilt.
+	events chan RegistryEvent
 }
 
 // stableOptions contains data about an ACME client that can be used to compare
@@ -88,22 +129,56 @@ type stableOptions struct {
 	issuerUID     string
 	publicKey     string
 	exponent      int
+
+	// eabKeyID and eabKey identify the External Account Binding credentials
+	// that were used to register the account. If either changes, the client
+	// must be rebuilt and the account re-registered with the ACME server.
+	eabKeyID string
+	eabKey   string
+
+	// solversHash is a digest of the issuer's 'solvers' stanza. If it
+	// changes, the client's instantiated Solvers must be rebuilt.
+	solversHash string
+
+	// proxyURL and rootCAsHash select which shared *http.Transport the
+	// client uses. If either changes, the client must be rebuilt so it
+	// picks up the (possibly different) shared transport.
+	proxyURL    string
+	rootCAsHash string
 }
 
 func (c stableOptions) equalTo(c2 stableOptions) bool {
 	return c == c2
 }
 
-func newStableOptions(uid string, config cmacme.ACMEIssuer, privateKey *rsa.PrivateKey) stableOptions {
+func newStableOptions(uid string, config cmacme.ACMEIssuer, privateKey *rsa.PrivateKey, eabAccountKey []byte) stableOptions {
 	// Encoding a big.Int cannot fail
 	publicNBytes, _ := privateKey.PublicKey.N.GobEncode()
-	return stableOptions{
+	opts := stableOptions{
 		serverURL:     config.Server,
 		skipVerifyTLS: config.SkipTLSVerify,
 		issuerUID:     uid,
 		publicKey:     string(publicNBytes),
 		exponent:      privateKey.PublicKey.E,
 	}
+	if eab := config.ExternalAccountBinding; eab != nil {
+		opts.eabKeyID = eab.KeyID
+		opts.eabKey = base64.RawURLEncoding.EncodeToString(eabAccountKey)
+	}
+	opts.solversHash = hashSolvers(config.Solvers)
+	opts.proxyURL = config.ProxyURL
+	opts.rootCAsHash = hashCABundle(config.CABundle)
+	return opts
+}
+
+// hashSolvers returns a stable digest of an issuer's 'solvers' stanza so it
+// can be compared for equality as part of stableOptions.
+func hashSolvers(solvers []cmacme.ACMEChallengeSolver) string {
+	// Solvers contain no secret material, so a JSON encoding is sufficient
+	// input for the digest; encoding/json does not fail on these types.
+	b, _ := json.Marshal(solvers)
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
 }
 
 // clientWithMeta wraps an ACME client with additional metadata used to
@@ -112,13 +187,24 @@ type clientWithMeta struct {
 	acmecl.Interface
 
 	stableOptions
+
+	// account is the ACME account that was registered/looked up for this
+	// client the last time it was (re)built. Its URI also serves as the
+	// account's 'KID' (Key ID) that is attached to every subsequent signed
+	// request made by the embedded client.
+	account *acmeapi.Account
+
+	// solvers holds the challenge Solvers instantiated for this client,
+	// keyed by the ACME challenge type they satisfy.
+	solvers solverSet
 }
 
 // AddClient will ensure the registry has a stored ACME client for the Issuer
-// object with the given UID, configuration and private key.
-func (r *registry) AddClient(uid string, config cmacme.ACMEIssuer, privateKey *rsa.PrivateKey) {
+// object with the given UID, configuration and private key. ctx bounds the
+// account registration/lookup round-trip made to the ACME server.
+func (r *registry) AddClient(ctx context.Context, uid string, config cmacme.ACMEIssuer, privateKey *rsa.PrivateKey, eabAccountKey []byte) error {
 	// ensure the client is up to date for the current configuration
-	r.ensureClient(uid, config, privateKey)
+	return r.ensureClient(ctx, uid, config, privateKey, eabAccountKey)
 }
 
 // ensureClient will ensure an ACME client with the given parameters is registered.
@@ -126,23 +212,102 @@ func (r *registry) AddClient(uid string, config cmacme.ACMEIssuer, privateKey *r
 // the client will NOT be mutated or replaced, allowing this method to be called
 // even if the client does not need replacing/updating without causing issues for
 // consumers of the registry.
-func (r *registry) ensureClient(uid string, config cmacme.ACMEIssuer, privateKey *rsa.PrivateKey) {
-	// acquire a read-write lock even if we hit the fast-path where the client
-	// is already present to avoid having to RLock, RUnlock and Lock again,
-	// which could itself cause a race
+// If a new client does need to be constructed, its ACME account will be
+// registered (or looked up, if one already exists for the account key) with
+// the configured ACME server before it is stored.
+//
+// Building the client and registering its account involves a live network
+// round-trip to the ACME server, which can be slow or hang outright against
+// an unreachable CA. That work deliberately happens without r.lock held, so
+// that GetClient/GetSolver/ListClients reads for every other issuer are
+// never blocked behind it; the lock is only taken to install the result.
+func (r *registry) ensureClient(ctx context.Context, uid string, config cmacme.ACMEIssuer, privateKey *rsa.PrivateKey, eabAccountKey []byte) error {
+	newOpts := newStableOptions(uid, config, privateKey, eabAccountKey)
+
+	r.lock.RLock()
+	existing, hasExisting := r.clients[uid]
+	r.lock.RUnlock()
+	// fast-path if there is nothing to do
+	if hasExisting && existing.equalTo(newOpts) {
+		registryEnsures.WithLabelValues("noop").Inc()
+		return nil
+	}
+
+	cl, err := newACMEClient(config, privateKey)
+	if err != nil {
+		return err
+	}
+	account, err := registerOrGetAccount(ctx, cl, config, eabAccountKey)
+	if err != nil {
+		return err
+	}
+	// cache the account's URI as the client's KID so that subsequent signed
+	// requests skip the account lookup/registration dance entirely.
+	cl.KID = acmeapi.KeyID(account.URI)
+	solvers := buildSolvers(cl, config.Solvers)
+
 	r.lock.Lock()
 	defer r.lock.Unlock()
-	newOpts := newStableOptions(uid, config, privateKey)
-	// fast-path if there is nothing to do
-	if meta, ok := r.clients[uid]; ok && meta.equalTo(newOpts) {
-		return
+	// re-read under the write lock: another caller may have installed an
+	// equivalent (or different) client while we were talking to the ACME
+	// server above.
+	existing, hasExisting = r.clients[uid]
+	if hasExisting && existing.equalTo(newOpts) {
+		closeSolvers(solvers)
+		registryEnsures.WithLabelValues("noop").Inc()
+		return nil
+	}
+	var rebuildReasons []string
+	if hasExisting {
+		rebuildReasons = diffRebuildReasons(existing.stableOptions, newOpts)
+		// tear down the solvers belonging to the client we're replacing
+		// before dropping our reference to them.
+		closeSolvers(existing.solvers)
 	}
-	// create a new client if one is not registered or if the
-	// 'metadata' does not match
+
 	r.clients[uid] = clientWithMeta{
-		Interface:     NewClient(config, privateKey),
+		Interface:     cl,
 		stableOptions: newOpts,
+		account:       account,
+		solvers:       solvers,
+	}
+	registryClients.Set(float64(len(r.clients)))
+	if hasExisting {
+		registryEnsures.WithLabelValues("rebuilt").Inc()
+		for _, reason := range rebuildReasons {
+			registryClientRebuilds.WithLabelValues(reason).Inc()
+		}
+		r.publish(uid, rebuildReasons)
+	} else {
+		registryEnsures.WithLabelValues("created").Inc()
 	}
+	return nil
+}
+
+// registerOrGetAccount registers cl's private key with the ACME server. Per
+// RFC 8555 section 7.3.1, a new-account request against a key that is
+// already registered replies 200 (rather than 201); Register reports that
+// as ErrAccountAlreadyExists, in which case the existing account is looked
+// up with GetReg instead. Either way the returned account is the one to
+// cache, whether this is the first registration or a later rebuild of a
+// client for the same key.
+func registerOrGetAccount(ctx context.Context, cl *acmeapi.Client, config cmacme.ACMEIssuer, eabAccountKey []byte) (*acmeapi.Account, error) {
+	acct := &acmeapi.Account{}
+	if eab := config.ExternalAccountBinding; eab != nil {
+		acct.ExternalAccountBinding = &acmeapi.ExternalAccountBinding{
+			KID: eab.KeyID,
+			Key: eabAccountKey,
+		}
+	}
+
+	account, err := cl.Register(ctx, acct, acmeapi.AcceptTOS)
+	if errors.Is(err, acmeapi.ErrAccountAlreadyExists) {
+		account, err = cl.GetReg(ctx, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
 }
 
 // GetClient will fetch a registered client using the UID of the Issuer
@@ -153,20 +318,54 @@ func (r *registry) GetClient(uid string) (acmecl.Interface, error) {
 	defer r.lock.RUnlock()
 	// fast-path if the client is already registered
 	if c, ok := r.clients[uid]; ok {
+		registryLookups.WithLabelValues("hit").Inc()
 		return c.Interface, nil
 	}
+	registryLookups.WithLabelValues("miss").Inc()
 	return nil, ErrNotFound
 }
 
+// GetAccount will return the ACME account registered for the client with the
+// given UID, as cached the last time the client was built.
+// If no client is found, ErrNotFound will be returned.
+func (r *registry) GetAccount(uid string) (*acmeapi.Account, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	c, ok := r.clients[uid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return c.account, nil
+}
+
+// GetSolver returns the instantiated challenge Solver for the client with
+// the given UID that handles the given ACME challenge type.
+func (r *registry) GetSolver(uid, challengeType string) (Solver, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	c, ok := r.clients[uid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	s, ok := c.solvers[cmacme.ACMEChallengeType(challengeType)]
+	if !ok {
+		return nil, ErrSolverNotFound
+	}
+	return s, nil
+}
+
 // RemoveClient will remove a registered client using the UID of the Issuer
 // resource that constructed it.
 func (r *registry) RemoveClient(uid string) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
-	if _, ok := r.clients[uid]; !ok {
+	c, ok := r.clients[uid]
+	if !ok {
 		return
 	}
+	closeSolvers(c.solvers)
 	delete(r.clients, uid)
+	registryClients.Set(float64(len(r.clients)))
 }
 
 // ListClients will return a full list of all ACME clients by their UIDs.
@@ -184,35 +383,43 @@ func (r *registry) ListClients() map[string]acmecl.Interface {
 	return out
 }
 
-func NewClient(config cmacme.ACMEIssuer, privateKey *rsa.PrivateKey) acmecl.Interface {
+// NewClient constructs a new ACME client for the given issuer configuration
+// and private key. The returned client has not yet been registered with the
+// ACME server - see the registry's ensureClient for that.
+func NewClient(config cmacme.ACMEIssuer, privateKey *rsa.PrivateKey) (acmecl.Interface, error) {
+	return newACMEClient(config, privateKey)
+}
+
+// newACMEClient is like NewClient but returns the concrete *acmeapi.Client
+// type so that registry internals can make use of account registration
+// methods that are not part of the narrower acmecl.Interface.
+func newACMEClient(config cmacme.ACMEIssuer, privateKey *rsa.PrivateKey) (*acmeapi.Client, error) {
+	httpClient, err := buildHTTPClient(config.SkipTLSVerify, config.ProxyURL, config.CABundle)
+	if err != nil {
+		return nil, err
+	}
 	return &acmeapi.Client{
 		Key:          privateKey,
-		HTTPClient:   buildHTTPClient(config.SkipTLSVerify),
+		HTTPClient:   httpClient,
 		DirectoryURL: config.Server,
 		UserAgent:    util.CertManagerUserAgent,
-	}
+	}, nil
 }
 
 // buildHTTPClient returns an HTTP client to be used by the ACME client.
-// For the time being, we construct a new HTTP client on each invocation.
-// This is because we need to set the 'skipTLSVerify' flag on the HTTP client
-// itself.
-// In future, we may change to having two global HTTP clients - one that ignores
-// TLS connection errors, and the other that does not.
-func buildHTTPClient(skipTLSVerify bool) *http.Client {
+// The underlying rate-limited transport is shared across every issuer that
+// agrees on skipTLSVerify, proxyURL and the CA bundle: idle connections and
+// HTTP/2 sessions are reused rather than torn down and rebuilt per issuer,
+// and the Retry-After back-off state tracked for 429/503 responses from the
+// ACME server is shared too, so two issuers on the same CA host don't each
+// independently trip and wait out the same rate limit.
+func buildHTTPClient(skipTLSVerify bool, proxyURL string, caBundle []byte) (*http.Client, error) {
+	transport, err := sharedTransport(skipTLSVerify, proxyURL, caBundle)
+	if err != nil {
+		return nil, err
+	}
 	return acmecl.NewInstrumentedClient(&http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			TLSClientConfig:       &tls.Config{InsecureSkipVerify: skipTLSVerify},
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
-		Timeout: time.Second * 30,
-	})
-}
\ No newline at end of file
+		Transport: transport,
+		Timeout:   time.Second * 30,
+	}), nil
+}
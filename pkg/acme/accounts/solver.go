@@ -0,0 +1,140 @@
+/*
+Copyright 2020 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounts
+
+import (
+	"crypto/tls"
+
+	acmeapi "golang.org/x/crypto/acme"
+
+	cmacme "github.com/jetstack/cert-manager/pkg/apis/acme/v1alpha2"
+)
+
+// ChallengeResponse holds the response material produced by a Solver for a
+// single ACME challenge token. Exactly one field is populated, matching the
+// Solver's challenge type.
+type ChallengeResponse struct {
+	// HTTP01 is the content that must be served at the http-01 well-known
+	// path in order to satisfy the challenge.
+	HTTP01 string
+
+	// DNS01 is the content of the TXT record that must be published in
+	// order to satisfy the challenge.
+	DNS01 string
+
+	// TLSALPN01 is the self-signed certificate that must be presented over
+	// TLS on the validation domain in order to satisfy the challenge.
+	TLSALPN01 *tls.Certificate
+}
+
+// Solver knows how to turn an ACME challenge token into the response
+// material required to satisfy a single ACME challenge type for the account
+// held by a registered client.
+type Solver interface {
+	// ChallengeType returns the ACME challenge type this Solver satisfies.
+	ChallengeType() cmacme.ACMEChallengeType
+
+	// Respond computes the response material for the given domain and
+	// challenge token.
+	Respond(domain, token string) (ChallengeResponse, error)
+}
+
+// solverSet is the collection of Solvers instantiated for a single
+// registered client, keyed by the ACME challenge type they satisfy.
+type solverSet map[cmacme.ACMEChallengeType]Solver
+
+// buildSolvers instantiates a Solver for each challenge type enabled in the
+// issuer's 'solvers' stanza, all sharing the given ACME client/account.
+func buildSolvers(cl *acmeapi.Client, solvers []cmacme.ACMEChallengeSolver) solverSet {
+	out := make(solverSet)
+	for _, s := range solvers {
+		if s.HTTP01 != nil {
+			out[cmacme.ACMEChallengeTypeHTTP01] = &http01Solver{cl: cl}
+		}
+		if s.DNS01 != nil {
+			out[cmacme.ACMEChallengeTypeDNS01] = &dns01Solver{cl: cl}
+		}
+		if s.TLSALPN01 != nil {
+			out[cmacme.ACMEChallengeTypeTLSALPN01] = &tlsALPN01Solver{cl: cl}
+		}
+	}
+	return out
+}
+
+// closeSolvers releases any resources held by solvers that support it. Most
+// solvers are stateless wrappers around the shared ACME client and have
+// nothing to release, but this gives future solvers (e.g. ones holding open
+// provider connections) a consistent teardown point when RemoveClient is
+// called.
+func closeSolvers(solvers solverSet) {
+	for _, s := range solvers {
+		if c, ok := s.(interface{ Close() }); ok {
+			c.Close()
+		}
+	}
+}
+
+// http01Solver satisfies the http-01 challenge type.
+type http01Solver struct {
+	cl *acmeapi.Client
+}
+
+func (s *http01Solver) ChallengeType() cmacme.ACMEChallengeType {
+	return cmacme.ACMEChallengeTypeHTTP01
+}
+
+func (s *http01Solver) Respond(_, token string) (ChallengeResponse, error) {
+	resp, err := s.cl.HTTP01ChallengeResponse(token)
+	if err != nil {
+		return ChallengeResponse{}, err
+	}
+	return ChallengeResponse{HTTP01: resp}, nil
+}
+
+// dns01Solver satisfies the dns-01 challenge type.
+type dns01Solver struct {
+	cl *acmeapi.Client
+}
+
+func (s *dns01Solver) ChallengeType() cmacme.ACMEChallengeType {
+	return cmacme.ACMEChallengeTypeDNS01
+}
+
+func (s *dns01Solver) Respond(_, token string) (ChallengeResponse, error) {
+	record, err := s.cl.DNS01ChallengeRecord(token)
+	if err != nil {
+		return ChallengeResponse{}, err
+	}
+	return ChallengeResponse{DNS01: record}, nil
+}
+
+// tlsALPN01Solver satisfies the tls-alpn-01 challenge type.
+type tlsALPN01Solver struct {
+	cl *acmeapi.Client
+}
+
+func (s *tlsALPN01Solver) ChallengeType() cmacme.ACMEChallengeType {
+	return cmacme.ACMEChallengeTypeTLSALPN01
+}
+
+func (s *tlsALPN01Solver) Respond(domain, token string) (ChallengeResponse, error) {
+	cert, err := s.cl.TLSALPN01ChallengeCert(token, domain)
+	if err != nil {
+		return ChallengeResponse{}, err
+	}
+	return ChallengeResponse{TLSALPN01: &cert}, nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2020 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounts
+
+import (
+	"testing"
+
+	cmacme "github.com/jetstack/cert-manager/pkg/apis/acme/v1alpha2"
+)
+
+func TestBuildSolvers(t *testing.T) {
+	tests := map[string]struct {
+		solvers []cmacme.ACMEChallengeSolver
+		want    []cmacme.ACMEChallengeType
+	}{
+		"no solvers configured": {
+			solvers: nil,
+			want:    nil,
+		},
+		"http01 only": {
+			solvers: []cmacme.ACMEChallengeSolver{{HTTP01: &cmacme.ACMEChallengeSolverHTTP01{}}},
+			want:    []cmacme.ACMEChallengeType{cmacme.ACMEChallengeTypeHTTP01},
+		},
+		"all three challenge types": {
+			solvers: []cmacme.ACMEChallengeSolver{
+				{HTTP01: &cmacme.ACMEChallengeSolverHTTP01{}},
+				{DNS01: &cmacme.ACMEChallengeSolverDNS01{}},
+				{TLSALPN01: &cmacme.ACMEChallengeSolverTLSALPN01{}},
+			},
+			want: []cmacme.ACMEChallengeType{
+				cmacme.ACMEChallengeTypeHTTP01,
+				cmacme.ACMEChallengeTypeDNS01,
+				cmacme.ACMEChallengeTypeTLSALPN01,
+			},
+		},
+		"entry with no type set is ignored": {
+			solvers: []cmacme.ACMEChallengeSolver{{}},
+			want:    nil,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := buildSolvers(nil, test.solvers)
+			if len(got) != len(test.want) {
+				t.Fatalf("buildSolvers() = %d solvers, want %d", len(got), len(test.want))
+			}
+			for _, challengeType := range test.want {
+				s, ok := got[challengeType]
+				if !ok {
+					t.Fatalf("buildSolvers() missing a solver for %s", challengeType)
+				}
+				if s.ChallengeType() != challengeType {
+					t.Errorf("solver for %s reports ChallengeType() = %s", challengeType, s.ChallengeType())
+				}
+			}
+		})
+	}
+}
+
+func TestGetSolverNotFound(t *testing.T) {
+	r := NewDefaultRegistry().(*registry)
+	r.clients["issuer-1"] = clientWithMeta{
+		solvers: buildSolvers(nil, []cmacme.ACMEChallengeSolver{{HTTP01: &cmacme.ACMEChallengeSolverHTTP01{}}}),
+	}
+
+	if _, err := r.GetSolver("issuer-1", string(cmacme.ACMEChallengeTypeHTTP01)); err != nil {
+		t.Errorf("GetSolver() for a configured challenge type returned error = %v", err)
+	}
+	if _, err := r.GetSolver("issuer-1", string(cmacme.ACMEChallengeTypeDNS01)); err != ErrSolverNotFound {
+		t.Errorf("GetSolver() for an unconfigured challenge type = %v, want ErrSolverNotFound", err)
+	}
+	if _, err := r.GetSolver("issuer-missing", string(cmacme.ACMEChallengeTypeHTTP01)); err != ErrNotFound {
+		t.Errorf("GetSolver() for an unregistered issuer = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2020 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounts
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// errCABundleInvalid is returned when an issuer's CA bundle does not contain
+// any parseable PEM-encoded certificates.
+var errCABundleInvalid = errors.New("no certificates found in CA bundle")
+
+// transportKey identifies the inputs that affect the shape of an
+// *http.Transport. Issuers that agree on all of these can safely share a
+// single transport (and therefore its connection pool/HTTP2 sessions)
+// rather than each paying the cost of a cold connection per request.
+type transportKey struct {
+	skipTLSVerify bool
+	proxyURL      string
+	rootCAsHash   string
+}
+
+// transportPool is a process-wide cache of shared, rate-limit-aware
+// transports, keyed by the options that affect their behaviour. It is
+// intentionally never pruned: the number of distinct (skipTLSVerify,
+// proxyURL, CA bundle) combinations in a cluster is bounded by the number
+// of distinct ACMEIssuer configurations, which is small.
+//
+// The rate-limited wrapper is pooled here, not just the raw *http.Transport:
+// its blockedTil back-off state must be shared by every issuer talking to
+// the same ACME host, or each one independently discovers and waits out the
+// same 429/503, defeating the point of honouring Retry-After.
+var transportPool = struct {
+	mu         sync.Mutex
+	transports map[transportKey]*rateLimitedTransport
+}{
+	transports: make(map[transportKey]*rateLimitedTransport),
+}
+
+// sharedTransport returns a process-wide shared, rate-limited RoundTripper
+// for the given options, constructing one on first use. Reusing the
+// underlying *http.Transport allows idle connections and HTTP/2 sessions to
+// be reused across issuers that are talking to the same ACME server with
+// the same TLS/proxy configuration, and reusing the rate-limited wrapper
+// around it lets them also share its Retry-After back-off state.
+func sharedTransport(skipTLSVerify bool, proxyURL string, caBundle []byte) (*rateLimitedTransport, error) {
+	key := transportKey{
+		skipTLSVerify: skipTLSVerify,
+		proxyURL:      proxyURL,
+		rootCAsHash:   hashCABundle(caBundle),
+	}
+
+	transportPool.mu.Lock()
+	defer transportPool.mu.Unlock()
+	if t, ok := transportPool.transports[key]; ok {
+		return t, nil
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if proxyURL != "" {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: skipTLSVerify}
+	if len(caBundle) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBundle) {
+			return nil, errCABundleInvalid
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	t := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	rt := newRateLimitedTransport(t)
+	transportPool.transports[key] = rt
+	return rt, nil
+}
+
+// hashCABundle returns a short, stable digest of a CA bundle so it can be
+// used as part of a transportKey/stableOptions without retaining the bundle
+// itself.
+func hashCABundle(caBundle []byte) string {
+	if len(caBundle) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(caBundle)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2020 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accounts
+
+import "testing"
+
+func TestSharedTransportReusesMatchingKeys(t *testing.T) {
+	t1, err := sharedTransport(false, "", nil)
+	if err != nil {
+		t.Fatalf("sharedTransport() error = %v", err)
+	}
+	t2, err := sharedTransport(false, "", nil)
+	if err != nil {
+		t.Fatalf("sharedTransport() error = %v", err)
+	}
+	if t1 != t2 {
+		t.Error("sharedTransport() returned distinct transports for identical inputs")
+	}
+
+	t3, err := sharedTransport(true, "", nil)
+	if err != nil {
+		t.Fatalf("sharedTransport() error = %v", err)
+	}
+	if t1 == t3 {
+		t.Error("sharedTransport() returned the same transport for differing skipTLSVerify")
+	}
+
+	t4, err := sharedTransport(false, "http://proxy.example.com:8080", nil)
+	if err != nil {
+		t.Fatalf("sharedTransport() error = %v", err)
+	}
+	if t1 == t4 {
+		t.Error("sharedTransport() returned the same transport for differing proxyURL")
+	}
+
+	if _, err := sharedTransport(false, "://not-a-valid-url", nil); err == nil {
+		t.Error("sharedTransport() with an invalid proxyURL did not return an error")
+	}
+
+	if _, err := sharedTransport(false, "", []byte("not a PEM bundle")); err != errCABundleInvalid {
+		t.Errorf("sharedTransport() with an invalid CA bundle = %v, want errCABundleInvalid", err)
+	}
+}
+
+func TestHashCABundle(t *testing.T) {
+	if got := hashCABundle(nil); got != "" {
+		t.Errorf("hashCABundle(nil) = %q, want empty string", got)
+	}
+
+	a := hashCABundle([]byte("bundle-a"))
+	b := hashCABundle([]byte("bundle-b"))
+	if a == "" || b == "" {
+		t.Fatal("hashCABundle() returned an empty digest for non-empty input")
+	}
+	if a == b {
+		t.Error("hashCABundle() returned the same digest for different bundles")
+	}
+	if got := hashCABundle([]byte("bundle-a")); got != a {
+		t.Error("hashCABundle() is not stable across calls with the same input")
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2020 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1alpha2 holds the ACMEIssuer configuration types for the Issuer
+// resource, consumed by the pkg/acme/accounts registry as well as the
+// webhook validation and issuer controller.
+package v1alpha2
+
+import (
+	cmmeta "github.com/jetstack/cert-manager/pkg/apis/meta/v1"
+)
+
+// ACMEIssuer contains the specification for an ACME issuer.
+type ACMEIssuer struct {
+	// Email is the email address to be associated with the ACME account.
+	// This field is optional, but it is strongly recommended to be set.
+	// It will be used to contact you in case of issues with your account or
+	// certificates, including expiry notification emails.
+	// This field may be updated after the account is initially registered.
+	Email string
+
+	// Server is the URL used to access the ACME server's 'directory' endpoint.
+	Server string
+
+	// SkipTLSVerify disables validating the ACME server's TLS certificate.
+	SkipTLSVerify bool
+
+	// CABundle is a PEM-encoded set of CA certificates to trust when
+	// connecting to the ACME server, used instead of the system trust store.
+	CABundle []byte
+
+	// ProxyURL, if set, is used to configure the HTTP client used to
+	// communicate with the ACME server to use a proxy.
+	ProxyURL string
+
+	// PrivateKey is the name of a Kubernetes Secret resource that will be
+	// used to store the account's private key.
+	PrivateKey cmmeta.SecretKeySelector
+
+	// DisableAccountKeyGeneration, if true, means the registry will not
+	// generate a new account private key if PrivateKey refers to a Secret
+	// that does not yet exist; instead, account registration will fail.
+	DisableAccountKeyGeneration bool
+
+	// ExternalAccountBinding is used to attach an External Account Binding
+	// to an ACME registration, as defined by RFC 8555 section 7.3.4.
+	ExternalAccountBinding *ACMEExternalAccountBinding
+
+	// Solvers is a list of challenge solvers that will be used to solve
+	// ACME challenges for the issuer.
+	Solvers []ACMEChallengeSolver
+}
+
+// ACMEExternalAccountBinding is used to attach External Account Bindings to
+// an ACME registration.
+type ACMEExternalAccountBinding struct {
+	// KeyID is the ID of the CA key that the External Account Binding key
+	// corresponds to, as assigned by the ACME server's operator.
+	KeyID string
+
+	// KeySecretRef is a Secret Key Selector referencing a data item in a
+	// Kubernetes Secret which holds the symmetric MAC key of the External
+	// Account Binding. The `key` is the index string that is paired with the
+	// key data in the Secret and should not be confused with the KeyID.
+	KeySecretRef cmmeta.SecretKeySelector
+}
+
+// ACMEChallengeType identifies a single ACME challenge type, as advertised
+// by an authorization's 'challenges' array.
+type ACMEChallengeType string
+
+const (
+	// ACMEChallengeTypeHTTP01 performs the http-01 challenge, as defined in
+	// RFC 8555 section 8.3.
+	ACMEChallengeTypeHTTP01 ACMEChallengeType = "http-01"
+
+	// ACMEChallengeTypeDNS01 performs the dns-01 challenge, as defined in
+	// RFC 8555 section 8.4.
+	ACMEChallengeTypeDNS01 ACMEChallengeType = "dns-01"
+
+	// ACMEChallengeTypeTLSALPN01 performs the tls-alpn-01 challenge, as
+	// defined in RFC 8737.
+	ACMEChallengeTypeTLSALPN01 ACMEChallengeType = "tls-alpn-01"
+)
+
+// ACMEChallengeSolver configures how challenges of a given type should be
+// solved for an issuer. Exactly one of HTTP01, DNS01 or TLSALPN01 is
+// typically set per entry.
+type ACMEChallengeSolver struct {
+	// HTTP01, if set, enables solving http-01 challenges for this issuer.
+	HTTP01 *ACMEChallengeSolverHTTP01
+
+	// DNS01, if set, enables solving dns-01 challenges for this issuer.
+	DNS01 *ACMEChallengeSolverDNS01
+
+	// TLSALPN01, if set, enables solving tls-alpn-01 challenges for this
+	// issuer.
+	TLSALPN01 *ACMEChallengeSolverTLSALPN01
+}
+
+// ACMEChallengeSolverHTTP01 configures provider-specific options for
+// solving the http-01 challenge type. It is currently empty: the accounts
+// registry only needs to know that http-01 is enabled for an issuer, not
+// how it is served.
+type ACMEChallengeSolverHTTP01 struct{}
+
+// ACMEChallengeSolverDNS01 configures provider-specific options for
+// solving the dns-01 challenge type. It is currently empty: the accounts
+// registry only needs to know that dns-01 is enabled for an issuer, not
+// which DNS provider serves it.
+type ACMEChallengeSolverDNS01 struct{}
+
+// ACMEChallengeSolverTLSALPN01 configures provider-specific options for
+// solving the tls-alpn-01 challenge type. It is currently empty: the
+// accounts registry only needs to know that tls-alpn-01 is enabled for an
+// issuer.
+type ACMEChallengeSolverTLSALPN01 struct{}
@@ -0,0 +1,35 @@
+/*
+Copyright 2020 The Jetstack cert-manager contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1 holds the small set of shared, non-resource-specific types
+// referenced by more than one cert-manager API group.
+package v1
+
+// LocalObjectReference is a reference to an object in the same namespace as
+// the referent.
+type LocalObjectReference struct {
+	// Name of the referent.
+	Name string
+}
+
+// SecretKeySelector selects a key of a Secret in the resource's namespace.
+type SecretKeySelector struct {
+	LocalObjectReference
+
+	// Key is the key of the Secret to select from. If unspecified, the first
+	// key of the Secret is used.
+	Key string
+}